@@ -1,7 +1,6 @@
 package main
 
 import (
-	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -30,6 +29,7 @@ type AlbumData struct {
 	UserID    string
 	Token     string
 	MyCli     *MyClient
+	IsGroup   bool
 }
 
 // AlbumWebhookPayload is the structure sent to webhook when album is complete
@@ -45,24 +45,29 @@ type AlbumWebhookPayload struct {
 	Images      []AlbumMessage `json:"images"`
 }
 
-// AlbumBuffer manages pending albums waiting to be aggregated
+// AlbumBuffer is the album-specific facade over the general EventBuffer
+// (see event_buffer.go). It used to own the albums map directly; it now
+// just registers the album grouping strategy and translates the
+// album-shaped API (AlbumData, albumID) that callers already depend on
+// into EventBuffer's generalized (EventType, groupKey, Batch) calls.
 type AlbumBuffer struct {
-	sync.RWMutex
-	albums      map[string]*AlbumData // key: albumId (parentMessageKey)
-	waitSeconds int
-	enabled     bool
+	eb *EventBuffer
 }
 
 // Global album buffer instance
 var albumBuffer *AlbumBuffer
 
-// InitAlbumBuffer initializes the global album buffer
+// InitAlbumBuffer initializes the global event buffer (if needed) and
+// registers album grouping on it.
 func InitAlbumBuffer(waitSeconds int, enabled bool) {
-	albumBuffer = &AlbumBuffer{
-		albums:      make(map[string]*AlbumData),
-		waitSeconds: waitSeconds,
-		enabled:     enabled,
+	if eventBuffer == nil {
+		InitEventBuffer()
 	}
+	eventBuffer.RegisterGroupKeyExtractor(EventTypeAlbum, HasParentMessageKey, BatchConfig{
+		WaitSeconds: waitSeconds,
+		Enabled:     enabled,
+	})
+	albumBuffer = &AlbumBuffer{eb: eventBuffer}
 	log.Info().
 		Int("waitSeconds", waitSeconds).
 		Bool("enabled", enabled).
@@ -76,142 +81,34 @@ func GetAlbumBuffer() *AlbumBuffer {
 
 // IsEnabled returns whether album grouping is enabled
 func (ab *AlbumBuffer) IsEnabled() bool {
-	return ab.enabled
+	return ab.eb.BatchConfigFor(EventTypeAlbum).Enabled
 }
 
 // AddMessage adds a message to an album buffer
 // Returns true if this is the first message in the album
 func (ab *AlbumBuffer) AddMessage(albumID string, msg AlbumMessage, metadata *AlbumData) bool {
-	ab.Lock()
-	defer ab.Unlock()
-
-	isFirst := false
-
-	album, exists := ab.albums[albumID]
-	if !exists {
-		// First message in this album
-		isFirst = true
-		album = &AlbumData{
-			AlbumID:   albumID,
-			ChatJID:   metadata.ChatJID,
-			SenderJID: metadata.SenderJID,
-			SenderAlt: metadata.SenderAlt,
-			Caption:   metadata.Caption,
-			Timestamp: metadata.Timestamp,
-			Messages:  []AlbumMessage{},
-			UserID:    metadata.UserID,
-			Token:     metadata.Token,
-			MyCli:     metadata.MyCli,
-		}
-		ab.albums[albumID] = album
-
-		// Start timer for this album
-		album.Timer = time.AfterFunc(time.Duration(ab.waitSeconds)*time.Second, func() {
-			ab.flushAlbum(albumID)
-		})
-
-		log.Info().
-			Str("albumId", albumID).
-			Str("chat", metadata.ChatJID).
-			Int("waitSeconds", ab.waitSeconds).
-			Msg("New album detected, starting buffer timer")
-	} else {
-		// Subsequent message - update caption if this one has it and previous didn't
-		if album.Caption == "" && metadata.Caption != "" {
-			album.Caption = metadata.Caption
-		}
-
-		// Reset timer since we got a new message
-		if album.Timer != nil {
-			album.Timer.Reset(time.Duration(ab.waitSeconds) * time.Second)
-		}
-	}
-
-	// Add message to album
-	album.Messages = append(album.Messages, msg)
-
-	log.Debug().
-		Str("albumId", albumID).
-		Str("messageId", msg.ID).
-		Int("totalMessages", len(album.Messages)).
-		Msg("Message added to album buffer")
-
-	return isFirst
-}
-
-// flushAlbum sends the aggregated album to webhook and removes it from buffer
-func (ab *AlbumBuffer) flushAlbum(albumID string) {
-	ab.Lock()
-	album, exists := ab.albums[albumID]
-	if !exists {
-		ab.Unlock()
-		return
-	}
-
-	// Stop timer if still running
-	if album.Timer != nil {
-		album.Timer.Stop()
-	}
-
-	// Remove from buffer
-	delete(ab.albums, albumID)
-	ab.Unlock()
-
-	log.Info().
-		Str("albumId", albumID).
-		Int("totalImages", len(album.Messages)).
-		Str("chat", album.ChatJID).
-		Msg("Flushing album buffer, sending webhook")
-
-	// Build webhook payload
-	payload := AlbumWebhookPayload{
-		Type:        "MessageAlbum",
-		AlbumID:     album.AlbumID,
-		Sender:      album.SenderAlt,
-		SenderLid:   album.SenderJID,
-		Chat:        album.ChatJID,
-		Caption:     album.Caption,
-		Timestamp:   album.Timestamp.Format(time.RFC3339),
-		TotalImages: len(album.Messages),
-		Images:      album.Messages,
-	}
-
-	// Send webhook using existing infrastructure
-	if album.MyCli != nil {
-		postmap := make(map[string]interface{})
-		postmap["type"] = "MessageAlbum"
-		postmap["albumId"] = payload.AlbumID
-		postmap["sender"] = payload.Sender
-		postmap["senderLid"] = payload.SenderLid
-		postmap["chat"] = payload.Chat
-		postmap["caption"] = payload.Caption
-		postmap["timestamp"] = payload.Timestamp
-		postmap["totalImages"] = payload.TotalImages
-		postmap["images"] = payload.Images
-
-		sendEventWithWebHook(album.MyCli, postmap, "")
-	}
+	return ab.eb.AddMessage(EventTypeAlbum, albumID, msg, &Batch{
+		ChatJID:   metadata.ChatJID,
+		SenderJID: metadata.SenderJID,
+		SenderAlt: metadata.SenderAlt,
+		Caption:   metadata.Caption,
+		Timestamp: metadata.Timestamp,
+		UserID:    metadata.UserID,
+		Token:     metadata.Token,
+		MyCli:     metadata.MyCli,
+		IsGroup:   metadata.IsGroup,
+	})
 }
 
 // CancelAlbum cancels a pending album (e.g., on disconnect)
 func (ab *AlbumBuffer) CancelAlbum(albumID string) {
-	ab.Lock()
-	defer ab.Unlock()
-
-	if album, exists := ab.albums[albumID]; exists {
-		if album.Timer != nil {
-			album.Timer.Stop()
-		}
-		delete(ab.albums, albumID)
-		log.Debug().Str("albumId", albumID).Msg("Album cancelled")
-	}
+	ab.eb.CancelBatch(EventTypeAlbum, albumID)
 }
 
-// GetPendingCount returns the number of pending albums
+// GetPendingCount returns the number of pending batches across all event
+// types (albums and every other registered grouping strategy).
 func (ab *AlbumBuffer) GetPendingCount() int {
-	ab.RLock()
-	defer ab.RUnlock()
-	return len(ab.albums)
+	return ab.eb.GetPendingCount()
 }
 
 // HasParentMessageKey checks if a message context contains a parent message key (album indicator)
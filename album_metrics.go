@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics for the event/album buffer, exposed on /metrics.
+// Labels are kept to "user"/"reason"/"status" only (no groupKey/chatJID) to
+// avoid unbounded cardinality.
+var (
+	albumBufferedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wuzapi_album_buffered_total",
+		Help: "Number of albums that started buffering, per user.",
+	}, []string{"user"})
+
+	albumFlushedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wuzapi_album_flushed_total",
+		Help: "Number of albums flushed, per user and flush reason (timer, size, cancel).",
+	}, []string{"user", "reason"})
+
+	albumSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "wuzapi_album_size",
+		Help:    "Number of images in a flushed album.",
+		Buckets: prometheus.LinearBuckets(1, 1, 10),
+	})
+
+	albumWaitSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "wuzapi_album_wait_seconds",
+		Help:    "Actual wall-clock time between an album's first message and its flush.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	albumPending = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "wuzapi_album_pending",
+		Help: "Current number of album batches (EventTypeAlbum only) sitting in the buffer.",
+	}, func() float64 {
+		if eventBuffer == nil {
+			return 0
+		}
+		return float64(eventBuffer.PendingCountForType(EventTypeAlbum))
+	})
+
+	webhookDeliveryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wuzapi_webhook_delivery_seconds",
+		Help:    "Webhook delivery latency per attempt, labeled by outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"status"})
+
+	webhookDeliveryTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wuzapi_webhook_delivery_total",
+		Help: "Webhook delivery attempts, labeled by outcome (success, retry, dead_letter).",
+	}, []string{"status"})
+)
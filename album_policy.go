@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// policiesBucket is the BoltDB bucket AlbumPolicy records are persisted
+// under, keyed by policy ID, so overrides survive a restart.
+var policiesBucket = []byte("album_policies")
+
+// PolicyScope identifies how specific an AlbumPolicy is. Precedence when
+// resolving effective settings runs user default -> group -> chat ->
+// sender, each more specific scope overriding the fields it sets on the
+// one before it.
+type PolicyScope string
+
+const (
+	PolicyScopeUser   PolicyScope = "user"   // per-user default, ScopeValue unused
+	PolicyScopeGroup  PolicyScope = "group"  // applies to every group chat for the user
+	PolicyScopeChat   PolicyScope = "chat"   // ScopeValue is a chatJID
+	PolicyScopeSender PolicyScope = "sender" // ScopeValue is a senderJID
+)
+
+// AlbumPolicy overrides album grouping settings for a (userID, scope,
+// scopeValue) combination, e.g. "disabled for this muted chat" or "8s wait
+// in large groups". A zero WaitSeconds/MaxBatchSize means "don't override
+// this field", so a narrower policy can tweak just one setting.
+type AlbumPolicy struct {
+	ID           string      `json:"id"`
+	UserID       string      `json:"userId"`
+	Scope        PolicyScope `json:"scope"`
+	ScopeValue   string      `json:"scopeValue,omitempty"`
+	WaitSeconds  int         `json:"waitSeconds,omitempty"`
+	MaxBatchSize int         `json:"maxBatchSize,omitempty"`
+	Enabled      *bool       `json:"enabled,omitempty"`
+}
+
+// PolicyResolver resolves the effective BatchConfig for a given
+// (userID, chatJID, senderJID, isGroup) tuple by layering AlbumPolicy
+// overrides on top of the EventType's base config. The in-memory map is
+// the source of truth for reads (Resolve/List run without touching disk);
+// Upsert/Delete write through to store when one is attached via
+// OpenPolicyStore, so policies survive a restart.
+type PolicyResolver struct {
+	sync.RWMutex
+	next     int
+	policies map[string]AlbumPolicy // by ID
+	store    *bolt.DB               // nil unless OpenPolicyStore was called
+}
+
+// NewPolicyResolver returns an empty, in-memory-only PolicyResolver. Call
+// OpenPolicyStore afterward to back it with persistent storage.
+func NewPolicyResolver() *PolicyResolver {
+	return &PolicyResolver{policies: make(map[string]AlbumPolicy)}
+}
+
+// OpenPolicyStore attaches db to pr and loads any policies already
+// persisted on it, the same rehydrate-on-startup pattern persistence.go
+// uses for pending batches. Call once at startup, after pr has been
+// created and before it's attached to an EventBuffer.
+func OpenPolicyStore(pr *PolicyResolver, db *bolt.DB) error {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(policiesBucket)
+		return err
+	}); err != nil {
+		return fmt.Errorf("create album policies bucket: %w", err)
+	}
+
+	pr.Lock()
+	defer pr.Unlock()
+	pr.store = db
+
+	return db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(policiesBucket).ForEach(func(k, v []byte) error {
+			var p AlbumPolicy
+			if err := json.Unmarshal(v, &p); err != nil {
+				log.Warn().Err(err).Str("key", string(k)).Msg("Skipping corrupt persisted album policy")
+				return nil
+			}
+			pr.policies[p.ID] = p
+			return nil
+		})
+	})
+}
+
+// persist writes a single policy to the store, if attached. Errors are
+// logged rather than returned so a storage hiccup doesn't roll back an
+// otherwise-successful in-memory Upsert.
+func (pr *PolicyResolver) persist(p AlbumPolicy) {
+	if pr.store == nil {
+		return
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Warn().Err(err).Str("policyId", p.ID).Msg("Failed to marshal album policy for persistence")
+		return
+	}
+	if err := pr.store.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(policiesBucket).Put([]byte(p.ID), data)
+	}); err != nil {
+		log.Warn().Err(err).Str("policyId", p.ID).Msg("Failed to persist album policy")
+	}
+}
+
+// deletePersisted removes a policy's persisted record, if a store is
+// attached.
+func (pr *PolicyResolver) deletePersisted(id string) {
+	if pr.store == nil {
+		return
+	}
+	if err := pr.store.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(policiesBucket).Delete([]byte(id))
+	}); err != nil {
+		log.Warn().Err(err).Str("policyId", id).Msg("Failed to delete persisted album policy")
+	}
+}
+
+// Upsert creates or replaces a policy. Pass p.ID empty to create.
+func (pr *PolicyResolver) Upsert(p AlbumPolicy) AlbumPolicy {
+	pr.Lock()
+	defer pr.Unlock()
+	if p.ID == "" {
+		// Skip IDs already taken, e.g. by policies OpenPolicyStore loaded.
+		for {
+			pr.next++
+			p.ID = fmt.Sprintf("policy-%d", pr.next)
+			if _, taken := pr.policies[p.ID]; !taken {
+				break
+			}
+		}
+	}
+	pr.policies[p.ID] = p
+	pr.persist(p)
+	return p
+}
+
+// Delete removes a policy by ID.
+func (pr *PolicyResolver) Delete(id string) bool {
+	pr.Lock()
+	defer pr.Unlock()
+	if _, ok := pr.policies[id]; !ok {
+		return false
+	}
+	delete(pr.policies, id)
+	pr.deletePersisted(id)
+	return true
+}
+
+// List returns every policy for a user.
+func (pr *PolicyResolver) List(userID string) []AlbumPolicy {
+	pr.RLock()
+	defer pr.RUnlock()
+	out := make([]AlbumPolicy, 0)
+	for _, p := range pr.policies {
+		if p.UserID == userID {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// findMatch returns the first policy matching (userID, scope, scopeValue),
+// if any.
+func (pr *PolicyResolver) findMatch(userID string, scope PolicyScope, scopeValue string) (AlbumPolicy, bool) {
+	for _, p := range pr.policies {
+		if p.UserID == userID && p.Scope == scope && p.ScopeValue == scopeValue {
+			return p, true
+		}
+	}
+	return AlbumPolicy{}, false
+}
+
+// applyOverride layers a policy's non-zero fields onto a base config.
+func applyOverride(base BatchConfig, p AlbumPolicy) BatchConfig {
+	if p.WaitSeconds > 0 {
+		base.WaitSeconds = p.WaitSeconds
+	}
+	if p.MaxBatchSize > 0 {
+		base.MaxBatchSize = p.MaxBatchSize
+	}
+	if p.Enabled != nil {
+		base.Enabled = *p.Enabled
+	}
+	return base
+}
+
+// Resolve returns the effective BatchConfig for a message, starting from
+// base (the EventType's registered default) and layering, in order: the
+// user's own default policy, a group-wide policy (only when isGroup),
+// a chat-specific policy, and finally a sender-specific policy - each
+// later match overriding only the fields it sets.
+func (pr *PolicyResolver) Resolve(userID, chatJID, senderJID string, isGroup bool, base BatchConfig) BatchConfig {
+	pr.RLock()
+	defer pr.RUnlock()
+
+	cfg := base
+	if p, ok := pr.findMatch(userID, PolicyScopeUser, ""); ok {
+		cfg = applyOverride(cfg, p)
+	}
+	if isGroup {
+		if p, ok := pr.findMatch(userID, PolicyScopeGroup, ""); ok {
+			cfg = applyOverride(cfg, p)
+		}
+	}
+	if p, ok := pr.findMatch(userID, PolicyScopeChat, chatJID); ok {
+		cfg = applyOverride(cfg, p)
+	}
+	if p, ok := pr.findMatch(userID, PolicyScopeSender, senderJID); ok {
+		cfg = applyOverride(cfg, p)
+	}
+	return cfg
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// handleAlbumPolicies serves the /albums/policies admin API:
+//
+//	GET    /albums/policies          - list policies for the caller's user
+//	POST   /albums/policies          - create or replace a policy
+//	DELETE /albums/policies/{id}     - remove a policy
+//
+// The caller's userID comes from the userId query param on GET and from the
+// decoded AlbumPolicy on POST; as with the other admin handlers in this
+// package, scoping it to the authenticated user is left to the admin
+// router's middleware.
+func handleAlbumPolicies(w http.ResponseWriter, r *http.Request) {
+	const base = "/albums/policies"
+
+	resolver := eventBuffer.PolicyResolverFor()
+	if resolver == nil {
+		http.Error(w, "policy resolver not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == base:
+		userID := r.URL.Query().Get("userId")
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resolver.List(userID)); err != nil {
+			log.Error().Err(err).Msg("Failed to encode album policies response")
+		}
+
+	case r.Method == http.MethodPost && r.URL.Path == base:
+		var p AlbumPolicy
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if p.UserID == "" {
+			http.Error(w, "userId is required", http.StatusBadRequest)
+			return
+		}
+		saved := resolver.Upsert(p)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(saved); err != nil {
+			log.Error().Err(err).Msg("Failed to encode saved album policy")
+		}
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, base+"/"):
+		id := strings.TrimPrefix(r.URL.Path, base+"/")
+		if !resolver.Delete(id) {
+			http.Error(w, "policy not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
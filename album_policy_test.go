@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestApplyOverrideOnlySetsNonZeroFields(t *testing.T) {
+	base := BatchConfig{WaitSeconds: 5, MaxBatchSize: 20, Enabled: true}
+
+	got := applyOverride(base, AlbumPolicy{WaitSeconds: 10})
+	want := BatchConfig{WaitSeconds: 10, MaxBatchSize: 20, Enabled: true}
+	if got != want {
+		t.Fatalf("applyOverride() = %+v, want %+v", got, want)
+	}
+
+	got = applyOverride(base, AlbumPolicy{Enabled: boolPtr(false)})
+	want = BatchConfig{WaitSeconds: 5, MaxBatchSize: 20, Enabled: false}
+	if got != want {
+		t.Fatalf("applyOverride() = %+v, want %+v", got, want)
+	}
+}
+
+func TestResolvePrecedenceUserGroupChatSender(t *testing.T) {
+	pr := NewPolicyResolver()
+	base := BatchConfig{WaitSeconds: 5, MaxBatchSize: 10, Enabled: true}
+
+	pr.Upsert(AlbumPolicy{UserID: "u1", Scope: PolicyScopeUser, WaitSeconds: 8})
+	pr.Upsert(AlbumPolicy{UserID: "u1", Scope: PolicyScopeGroup, WaitSeconds: 12})
+	pr.Upsert(AlbumPolicy{UserID: "u1", Scope: PolicyScopeChat, ScopeValue: "chat1", WaitSeconds: 20})
+	pr.Upsert(AlbumPolicy{UserID: "u1", Scope: PolicyScopeSender, ScopeValue: "sender1", Enabled: boolPtr(false)})
+
+	// Sender override should win on Enabled, but chat override's WaitSeconds
+	// (20) should still apply since the sender policy doesn't set it.
+	got := pr.Resolve("u1", "chat1", "sender1", true, base)
+	want := BatchConfig{WaitSeconds: 20, MaxBatchSize: 10, Enabled: false}
+	if got != want {
+		t.Fatalf("Resolve() = %+v, want %+v", got, want)
+	}
+}
+
+func TestResolveGroupPolicyOnlyAppliesToGroups(t *testing.T) {
+	pr := NewPolicyResolver()
+	base := BatchConfig{WaitSeconds: 5, MaxBatchSize: 10, Enabled: true}
+	pr.Upsert(AlbumPolicy{UserID: "u1", Scope: PolicyScopeGroup, WaitSeconds: 99})
+
+	got := pr.Resolve("u1", "chat1", "sender1", false, base)
+	if got.WaitSeconds != 5 {
+		t.Fatalf("expected group policy to be skipped for a non-group chat, got WaitSeconds=%d", got.WaitSeconds)
+	}
+}
+
+func TestResolveNoPoliciesReturnsBaseUnchanged(t *testing.T) {
+	pr := NewPolicyResolver()
+	base := BatchConfig{WaitSeconds: 5, MaxBatchSize: 10, Enabled: true}
+
+	got := pr.Resolve("u1", "chat1", "sender1", true, base)
+	if got != base {
+		t.Fatalf("Resolve() = %+v, want unchanged base %+v", got, base)
+	}
+}
+
+func TestPolicyResolverDeleteRemovesMatch(t *testing.T) {
+	pr := NewPolicyResolver()
+	p := pr.Upsert(AlbumPolicy{UserID: "u1", Scope: PolicyScopeChat, ScopeValue: "chat1", WaitSeconds: 30})
+
+	if !pr.Delete(p.ID) {
+		t.Fatal("expected Delete to report the policy was found")
+	}
+	if pr.Delete(p.ID) {
+		t.Fatal("expected a second Delete of the same ID to report not found")
+	}
+
+	got := pr.Resolve("u1", "chat1", "sender1", false, BatchConfig{WaitSeconds: 5})
+	if got.WaitSeconds != 5 {
+		t.Fatalf("expected deleted policy to no longer apply, got WaitSeconds=%d", got.WaitSeconds)
+	}
+}
+
+func TestPolicyResolverSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.db")
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		t.Fatalf("open bolt store: %v", err)
+	}
+
+	pr := NewPolicyResolver()
+	if err := OpenPolicyStore(pr, db); err != nil {
+		t.Fatalf("OpenPolicyStore: %v", err)
+	}
+	saved := pr.Upsert(AlbumPolicy{UserID: "u1", Scope: PolicyScopeChat, ScopeValue: "chat1", WaitSeconds: 42})
+	db.Close()
+
+	// Simulate a restart: reopen the same file into a fresh, empty resolver.
+	db2, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		t.Fatalf("reopen bolt store: %v", err)
+	}
+	defer db2.Close()
+
+	restored := NewPolicyResolver()
+	if err := OpenPolicyStore(restored, db2); err != nil {
+		t.Fatalf("OpenPolicyStore on reopen: %v", err)
+	}
+
+	list := restored.List("u1")
+	if len(list) != 1 || list[0].ID != saved.ID || list[0].WaitSeconds != 42 {
+		t.Fatalf("expected the persisted policy to be restored, got %+v", list)
+	}
+}
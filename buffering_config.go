@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// bufferingConfigEntry is the wire shape for one EventType's grouping
+// settings, used by both GET and POST /buffering/config.
+type bufferingConfigEntry struct {
+	EventType    string `json:"eventType"`
+	WaitSeconds  int    `json:"waitSeconds"`
+	MaxBatchSize int    `json:"maxBatchSize"`
+	Enabled      bool   `json:"enabled"`
+}
+
+// bufferingConfigRequest is the wire shape for POST /buffering/config: a
+// bufferingConfigEntry plus the userId it applies to, so enabling a
+// grouping strategy only affects that user (see
+// EventBuffer.SetUserBatchConfig), matching the userId body field
+// handleAlbumPolicies' POST uses for the same purpose.
+type bufferingConfigRequest struct {
+	UserID string `json:"userId"`
+	bufferingConfigEntry
+}
+
+// knownEventTypes lists every EventType exposed through the buffering
+// config API, album first.
+var knownEventTypes = []EventType{
+	EventTypeAlbum,
+	EventTypeTextBurst,
+	EventTypeForwardBundle,
+	EventTypeReactionBatch,
+}
+
+// handleBufferingConfig serves GET/POST /buffering/config: GET returns the
+// effective per-event-type grouping settings for the given userId query
+// param, POST updates one entry for one user. Settings are per user (see
+// EventBuffer.SetUserBatchConfig/UserBatchConfigFor) so enabling a
+// non-album type here only affects that user the next time
+// message-handling code calls EventBuffer.RouteIncomingMessage (see
+// message_router.go), which is what actually applies each type's
+// GroupKeyExtractor to incoming messages. Wiring this endpoint into the
+// admin router's auth/user-scoping middleware is left to routes.go, which
+// is not part of this package.
+func handleBufferingConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		userID := r.URL.Query().Get("userId")
+		if userID == "" {
+			http.Error(w, "userId is required", http.StatusBadRequest)
+			return
+		}
+		entries := make([]bufferingConfigEntry, 0, len(knownEventTypes))
+		for _, t := range knownEventTypes {
+			cfg := eventBuffer.UserBatchConfigFor(userID, t)
+			entries = append(entries, bufferingConfigEntry{
+				EventType:    string(t),
+				WaitSeconds:  cfg.WaitSeconds,
+				MaxBatchSize: cfg.MaxBatchSize,
+				Enabled:      cfg.Enabled,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			log.Error().Err(err).Msg("Failed to encode buffering config response")
+		}
+
+	case http.MethodPost:
+		var req bufferingConfigRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.UserID == "" {
+			http.Error(w, "userId is required", http.StatusBadRequest)
+			return
+		}
+
+		t := EventType(req.EventType)
+		if _, ok := eventBuffer.ExtractorFor(t); !ok {
+			http.Error(w, "unknown event type", http.StatusBadRequest)
+			return
+		}
+
+		eventBuffer.SetUserBatchConfig(req.UserID, t, BatchConfig{
+			WaitSeconds:  req.WaitSeconds,
+			MaxBatchSize: req.MaxBatchSize,
+			Enabled:      req.Enabled,
+		})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// clientRegistration pairs a live connection with the token it was
+// registered under, so lookupClientForUser can validate a rehydrated
+// batch's token before handing the client back out.
+type clientRegistration struct {
+	token string
+	cli   *MyClient
+}
+
+// clientRegistry tracks connected *MyClient instances by userID, so code
+// that only has a userID/token on disk (a rehydrated batch, see
+// persistence.go) can re-attach to the live connection. It's populated by
+// whatever owns client connect/disconnect, which is outside this
+// package's scope in this tree - call RegisterClient/UnregisterClient from
+// there.
+var clientRegistry = struct {
+	sync.RWMutex
+	clients map[string]clientRegistration
+}{clients: make(map[string]clientRegistration)}
+
+// RegisterClient records the live client for a user so it can later be
+// found by lookupClientForUser. Call this wherever a user's MyClient is
+// constructed/connected.
+//
+// If the event buffer has any batches rehydrated from disk still waiting
+// on this user's client to reconnect, registering it here immediately
+// attaches them instead of waiting for Rehydrate's retry timer (see
+// persistence.go's pendingRehydrations).
+func RegisterClient(userID, token string, cli *MyClient) {
+	clientRegistry.Lock()
+	clientRegistry.clients[userID] = clientRegistration{token: token, cli: cli}
+	clientRegistry.Unlock()
+
+	if eventBuffer != nil {
+		eventBuffer.retryPendingRehydrationsForUser(userID)
+	}
+}
+
+// UnregisterClient drops a user's registered client, e.g. on disconnect.
+func UnregisterClient(userID string) {
+	clientRegistry.Lock()
+	defer clientRegistry.Unlock()
+	delete(clientRegistry.clients, userID)
+}
+
+// lookupClientForUser returns the live client registered for userID,
+// validating it was registered with the given token. Used by Rehydrate to
+// re-attach a rehydrated batch to its connection.
+func lookupClientForUser(userID, token string) (*MyClient, error) {
+	clientRegistry.RLock()
+	defer clientRegistry.RUnlock()
+
+	reg, ok := clientRegistry.clients[userID]
+	if !ok {
+		return nil, fmt.Errorf("no connected client registered for user %s", userID)
+	}
+	if reg.token != token {
+		return nil, fmt.Errorf("token mismatch for user %s", userID)
+	}
+	return reg.cli, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestLookupClientForUser(t *testing.T) {
+	cli := &MyClient{}
+	RegisterClient("user1", "secret-token", cli)
+	defer UnregisterClient("user1")
+
+	got, err := lookupClientForUser("user1", "secret-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != cli {
+		t.Fatal("expected the registered client back")
+	}
+}
+
+func TestLookupClientForUserTokenMismatch(t *testing.T) {
+	RegisterClient("user2", "secret-token", &MyClient{})
+	defer UnregisterClient("user2")
+
+	if _, err := lookupClientForUser("user2", "wrong-token"); err == nil {
+		t.Fatal("expected an error for a mismatched token")
+	}
+}
+
+func TestLookupClientForUserNotRegistered(t *testing.T) {
+	if _, err := lookupClientForUser("no-such-user", "anything"); err == nil {
+		t.Fatal("expected an error for an unregistered user")
+	}
+}
+
+func TestUnregisterClient(t *testing.T) {
+	RegisterClient("user3", "tok", &MyClient{})
+	UnregisterClient("user3")
+
+	if _, err := lookupClientForUser("user3", "tok"); err == nil {
+		t.Fatal("expected an error after unregistering the client")
+	}
+}
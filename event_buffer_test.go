@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+// TestPendingCountForTypeScopesToOneType guards against wuzapi_album_pending
+// drifting back to counting every event type instead of just albums.
+func TestPendingCountForTypeScopesToOneType(t *testing.T) {
+	InitEventBuffer()
+	eventBuffer.RegisterGroupKeyExtractor(EventTypeAlbum, HasParentMessageKey, BatchConfig{WaitSeconds: 5, Enabled: true})
+	eventBuffer.SetBatchConfig(EventTypeTextBurst, BatchConfig{WaitSeconds: 5, Enabled: true})
+
+	eventBuffer.AddMessage(EventTypeAlbum, "album1", AlbumMessage{ID: "m1"}, &Batch{UserID: "u1"})
+	eventBuffer.AddMessage(EventTypeTextBurst, "burst1", AlbumMessage{ID: "m2"}, &Batch{UserID: "u1"})
+	eventBuffer.AddMessage(EventTypeTextBurst, "burst2", AlbumMessage{ID: "m3"}, &Batch{UserID: "u1"})
+
+	if got := eventBuffer.GetPendingCount(); got != 3 {
+		t.Fatalf("GetPendingCount() = %d, want 3", got)
+	}
+	if got := eventBuffer.PendingCountForType(EventTypeAlbum); got != 1 {
+		t.Fatalf("PendingCountForType(EventTypeAlbum) = %d, want 1", got)
+	}
+	if got := eventBuffer.PendingCountForType(EventTypeTextBurst); got != 2 {
+		t.Fatalf("PendingCountForType(EventTypeTextBurst) = %d, want 2", got)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+// Built-in GroupKeyExtractor implementations beyond HasParentMessageKey
+// (album_buffer.go). Each reads the keys it cares about from the generic
+// msgContext map so the EventBuffer plumbing stays agnostic of event type.
+
+// TextBurstGroupKey groups consecutive text messages from the same sender
+// in the same chat, so a burst of short messages sent back-to-back is
+// delivered as a single MessageTextBurst webhook instead of one per line.
+func TextBurstGroupKey(msgContext map[string]interface{}) (string, bool) {
+	chat, _ := msgContext["chatJid"].(string)
+	sender, _ := msgContext["senderJid"].(string)
+	if chat == "" || sender == "" {
+		return "", false
+	}
+	return "burst:" + chat + ":" + sender, true
+}
+
+// ForwardBundleGroupKey groups a chain of forwarded messages sent by the
+// same sender in the same chat into a single MessageForwardBundle webhook.
+func ForwardBundleGroupKey(msgContext map[string]interface{}) (string, bool) {
+	ctxInfo, ok := msgContext["contextInfo"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	score, ok := ctxInfo["forwardingScore"].(float64)
+	if !ok || score <= 0 {
+		return "", false
+	}
+	chat, _ := msgContext["chatJid"].(string)
+	sender, _ := msgContext["senderJid"].(string)
+	if chat == "" || sender == "" {
+		return "", false
+	}
+	return "forward:" + chat + ":" + sender, true
+}
+
+// ReactionBatchGroupKey groups reactions landing on the same target message
+// into a single ReactionBatch webhook.
+func ReactionBatchGroupKey(msgContext map[string]interface{}) (string, bool) {
+	reaction, ok := msgContext["reaction"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	targetID, ok := reaction["targetMessageId"].(string)
+	if !ok || targetID == "" {
+		return "", false
+	}
+	return "reaction:" + targetID, true
+}
@@ -0,0 +1,158 @@
+package main
+
+import "testing"
+
+func TestTextBurstGroupKey(t *testing.T) {
+	cases := []struct {
+		name    string
+		ctx     map[string]interface{}
+		wantKey string
+		wantOK  bool
+	}{
+		{
+			name:    "chat and sender present",
+			ctx:     map[string]interface{}{"chatJid": "chat1", "senderJid": "sender1"},
+			wantKey: "burst:chat1:sender1",
+			wantOK:  true,
+		},
+		{name: "missing sender", ctx: map[string]interface{}{"chatJid": "chat1"}, wantOK: false},
+		{name: "nil context", ctx: nil, wantOK: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, ok := TextBurstGroupKey(c.ctx)
+			if ok != c.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, c.wantOK)
+			}
+			if ok && key != c.wantKey {
+				t.Fatalf("key = %q, want %q", key, c.wantKey)
+			}
+		})
+	}
+}
+
+func TestForwardBundleGroupKey(t *testing.T) {
+	cases := []struct {
+		name    string
+		ctx     map[string]interface{}
+		wantKey string
+		wantOK  bool
+	}{
+		{
+			name: "forwarded with positive score",
+			ctx: map[string]interface{}{
+				"chatJid": "chat1", "senderJid": "sender1",
+				"contextInfo": map[string]interface{}{"forwardingScore": float64(2)},
+			},
+			wantKey: "forward:chat1:sender1",
+			wantOK:  true,
+		},
+		{
+			name: "zero score is not a forward",
+			ctx: map[string]interface{}{
+				"chatJid": "chat1", "senderJid": "sender1",
+				"contextInfo": map[string]interface{}{"forwardingScore": float64(0)},
+			},
+			wantOK: false,
+		},
+		{name: "no contextInfo", ctx: map[string]interface{}{"chatJid": "chat1", "senderJid": "sender1"}, wantOK: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, ok := ForwardBundleGroupKey(c.ctx)
+			if ok != c.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, c.wantOK)
+			}
+			if ok && key != c.wantKey {
+				t.Fatalf("key = %q, want %q", key, c.wantKey)
+			}
+		})
+	}
+}
+
+func TestReactionBatchGroupKey(t *testing.T) {
+	cases := []struct {
+		name    string
+		ctx     map[string]interface{}
+		wantKey string
+		wantOK  bool
+	}{
+		{
+			name:    "target present",
+			ctx:     map[string]interface{}{"reaction": map[string]interface{}{"targetMessageId": "msg1"}},
+			wantKey: "reaction:msg1",
+			wantOK:  true,
+		},
+		{name: "no reaction", ctx: map[string]interface{}{}, wantOK: false},
+		{name: "empty target", ctx: map[string]interface{}{"reaction": map[string]interface{}{"targetMessageId": ""}}, wantOK: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, ok := ReactionBatchGroupKey(c.ctx)
+			if ok != c.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, c.wantOK)
+			}
+			if ok && key != c.wantKey {
+				t.Fatalf("key = %q, want %q", key, c.wantKey)
+			}
+		})
+	}
+}
+
+// TestRouteIncomingMessage proves the registered-but-previously-unused
+// extractors actually get invoked: enabling EventTypeTextBurst and routing
+// a matching message must start a real batch for it.
+func TestRouteIncomingMessage(t *testing.T) {
+	InitEventBuffer()
+	eventBuffer.SetBatchConfig(EventTypeTextBurst, BatchConfig{WaitSeconds: 5, Enabled: true})
+
+	msgContext := map[string]interface{}{"chatJid": "chat1", "senderJid": "sender1"}
+	metadata := &Batch{ChatJID: "chat1", SenderJID: "sender1", UserID: "user1"}
+
+	eventType, isFirst, ok := eventBuffer.RouteIncomingMessage(msgContext, AlbumMessage{ID: "m1"}, metadata)
+	if !ok {
+		t.Fatal("expected RouteIncomingMessage to match the enabled text-burst extractor")
+	}
+	if eventType != EventTypeTextBurst {
+		t.Fatalf("eventType = %v, want %v", eventType, EventTypeTextBurst)
+	}
+	if !isFirst {
+		t.Fatal("expected first routed message to start a new batch")
+	}
+	if got := eventBuffer.GetPendingCount(); got != 1 {
+		t.Fatalf("pending count = %d, want 1", got)
+	}
+}
+
+// TestRouteIncomingMessageIsPerUser guards against SetUserBatchConfig (and
+// the buffering config settings it backs) leaking across users: one user
+// opting into text-burst batching must not enable it for another user who
+// never asked for it.
+func TestRouteIncomingMessageIsPerUser(t *testing.T) {
+	InitEventBuffer()
+	eventBuffer.SetUserBatchConfig("user1", EventTypeTextBurst, BatchConfig{WaitSeconds: 5, Enabled: true})
+
+	msgContext := map[string]interface{}{"chatJid": "chat1", "senderJid": "sender1"}
+
+	_, _, ok := eventBuffer.RouteIncomingMessage(msgContext, AlbumMessage{ID: "m1"}, &Batch{ChatJID: "chat1", SenderJID: "sender1", UserID: "user1"})
+	if !ok {
+		t.Fatal("expected text-burst to be enabled for user1")
+	}
+
+	_, _, ok = eventBuffer.RouteIncomingMessage(msgContext, AlbumMessage{ID: "m2"}, &Batch{ChatJID: "chat1", SenderJID: "sender1", UserID: "user2"})
+	if ok {
+		t.Fatal("expected text-burst to remain disabled for user2, who has no override")
+	}
+}
+
+func TestRouteIncomingMessageNoMatch(t *testing.T) {
+	InitEventBuffer() // every non-album type ships disabled
+
+	_, _, ok := eventBuffer.RouteIncomingMessage(map[string]interface{}{"chatJid": "chat1", "senderJid": "sender1"}, AlbumMessage{ID: "m1"}, &Batch{})
+	if ok {
+		t.Fatal("expected no match: text burst is disabled by default")
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// MediaStorageConfig holds the per-user object storage settings used when
+// uploading album media once a batch is flushed. This tree has no users
+// table to add s3_provider/s3_endpoint/s3_bucket/... columns to, so they're
+// persisted in their own BoltDB bucket instead (see user_settings_store.go)
+// and managed through the /users/{id}/media-storage admin API
+// (media_storage_handler.go).
+type MediaStorageConfig struct {
+	Provider     string // "s3", "minio", "webdav" or "local-disk"
+	Endpoint     string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	Prefix       string
+	PresignedTTL time.Duration
+	Retention    time.Duration
+}
+
+// UploadResult describes where a media item ended up after being uploaded
+// to the configured object store. It is embedded verbatim into the
+// AlbumMessage.S3 map before the webhook fires.
+type UploadResult struct {
+	URL      string
+	Bucket   string
+	Key      string
+	Size     int64
+	MimeType string
+}
+
+// MediaStorage uploads a single media item to an object store and returns
+// the location metadata to attach to its AlbumMessage.
+type MediaStorage interface {
+	Upload(ctx context.Context, cfg MediaStorageConfig, key string, data []byte, mimeType string) (*UploadResult, error)
+}
+
+// NewMediaStorage returns the MediaStorage implementation for the given
+// provider name, as configured on the user record.
+func NewMediaStorage(provider string) (MediaStorage, error) {
+	switch provider {
+	case "s3":
+		return &s3MediaStorage{}, nil
+	case "minio":
+		return &minioMediaStorage{}, nil
+	case "webdav":
+		return &webdavMediaStorage{}, nil
+	case "local-disk", "":
+		return &localDiskMediaStorage{}, nil
+	default:
+		return nil, fmt.Errorf("unknown media storage provider %q", provider)
+	}
+}
+
+// objectKey builds the storage key for a media item, honoring the
+// user-configured prefix. albumID/messageID/fileName all ultimately trace
+// back to values the message sender controls (a WhatsApp document's
+// filename, in particular), so each is reduced to a single sanitized path
+// component before being joined - otherwise a filename like
+// "../../../../etc/cron.d/evil" would survive filepath.Join and let a
+// sender write outside the configured storage root (see
+// localDiskMediaStorage.Upload and webdavMediaStorage.Upload, both of
+// which build their final path from this function's result).
+func objectKey(cfg MediaStorageConfig, albumID, messageID, fileName string) string {
+	name := fileName
+	if name == "" {
+		name = messageID
+	}
+	name = sanitizePathComponent(name)
+	albumID = sanitizePathComponent(albumID)
+	if cfg.Prefix != "" {
+		return filepath.Join(cfg.Prefix, albumID, name)
+	}
+	return filepath.Join(albumID, name)
+}
+
+// sanitizePathComponent reduces s to a single safe path segment: any
+// directory separators or ".."/"." traversal are stripped by taking just
+// the final element of its cleaned form, so the result can never escape
+// the directory it's joined into. Falls back to "unnamed" if nothing
+// usable remains (e.g. s was "", ".", "..", or "/").
+func sanitizePathComponent(s string) string {
+	s = filepath.Base(filepath.Clean(s))
+	if s == "" || s == "." || s == ".." || s == string(filepath.Separator) {
+		return "unnamed"
+	}
+	return s
+}
+
+// s3MediaStorage uploads media to an S3-compatible bucket (AWS S3 or R2).
+type s3MediaStorage struct{}
+
+func (s *s3MediaStorage) Upload(ctx context.Context, cfg MediaStorageConfig, key string, data []byte, mimeType string) (*UploadResult, error) {
+	client, err := newS3Client(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("s3 client: %w", err)
+	}
+	if err := client.PutObject(ctx, cfg.Bucket, key, data, mimeType); err != nil {
+		return nil, fmt.Errorf("s3 upload: %w", err)
+	}
+	url, err := client.SignedURL(ctx, cfg.Bucket, key, cfg.PresignedTTL)
+	if err != nil {
+		return nil, fmt.Errorf("s3 presign: %w", err)
+	}
+	return &UploadResult{URL: url, Bucket: cfg.Bucket, Key: key, Size: int64(len(data)), MimeType: mimeType}, nil
+}
+
+// minioMediaStorage uploads media to a self-hosted MinIO instance using the
+// same wire protocol as s3MediaStorage but a distinct endpoint/credential
+// path so the two can be configured independently.
+type minioMediaStorage struct{}
+
+func (m *minioMediaStorage) Upload(ctx context.Context, cfg MediaStorageConfig, key string, data []byte, mimeType string) (*UploadResult, error) {
+	client, err := newMinioClient(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("minio client: %w", err)
+	}
+	if err := client.PutObject(ctx, cfg.Bucket, key, data, mimeType); err != nil {
+		return nil, fmt.Errorf("minio upload: %w", err)
+	}
+	url, err := client.SignedURL(ctx, cfg.Bucket, key, cfg.PresignedTTL)
+	if err != nil {
+		return nil, fmt.Errorf("minio presign: %w", err)
+	}
+	return &UploadResult{URL: url, Bucket: cfg.Bucket, Key: key, Size: int64(len(data)), MimeType: mimeType}, nil
+}
+
+// webdavMediaStorage uploads media to a WebDAV share. There is no bucket
+// concept, so cfg.Bucket is used as the top-level collection name.
+type webdavMediaStorage struct{}
+
+func (w *webdavMediaStorage) Upload(ctx context.Context, cfg MediaStorageConfig, key string, data []byte, mimeType string) (*UploadResult, error) {
+	client := newWebDAVClient(cfg.Endpoint, cfg.AccessKey, cfg.SecretKey)
+	fullPath := filepath.Join(cfg.Bucket, key)
+	if err := client.Put(ctx, fullPath, data, mimeType); err != nil {
+		return nil, fmt.Errorf("webdav upload: %w", err)
+	}
+	return &UploadResult{URL: client.PublicURL(fullPath), Bucket: cfg.Bucket, Key: key, Size: int64(len(data)), MimeType: mimeType}, nil
+}
+
+// localDiskMediaStorage is the default provider: it writes media under
+// cfg.Bucket (treated as a directory rooted at the local media path) so
+// deployments without object storage still get a persisted S3 block.
+type localDiskMediaStorage struct{}
+
+func (l *localDiskMediaStorage) Upload(ctx context.Context, cfg MediaStorageConfig, key string, data []byte, mimeType string) (*UploadResult, error) {
+	root := cfg.Bucket
+	if root == "" {
+		root = "media"
+	}
+	dest := filepath.Join(root, key)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return nil, fmt.Errorf("local-disk mkdir: %w", err)
+	}
+	if err := os.WriteFile(dest, data, 0o644); err != nil {
+		return nil, fmt.Errorf("local-disk write: %w", err)
+	}
+	return &UploadResult{URL: dest, Bucket: root, Key: key, Size: int64(len(data)), MimeType: mimeType}, nil
+}
+
+// decodeMediaPayload returns the raw bytes for a media item, preferring an
+// inline Base64 payload and falling back to fetching msg.URL.
+func decodeMediaPayload(msg *AlbumMessage) ([]byte, error) {
+	if msg.Base64 != "" {
+		data, err := base64.StdEncoding.DecodeString(msg.Base64)
+		if err != nil {
+			return nil, fmt.Errorf("decode base64: %w", err)
+		}
+		return data, nil
+	}
+
+	if msg.URL != "" {
+		resp, err := http.Get(msg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("fetch url: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch url: unexpected status %d", resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}
+
+	return nil, fmt.Errorf("message %s has neither url nor base64 payload", msg.ID)
+}
+
+// uploadAlbumMedia uploads every message in a flushed album batch to the
+// user's configured media storage, mutating msg.S3 in place. Messages that
+// have neither a URL nor Base64 payload, or whose decode/upload fails, are
+// left untouched and logged so the webhook still fires with the rest.
+func uploadAlbumMedia(album *Batch) {
+	if album.MyCli == nil {
+		return
+	}
+
+	cfg, err := getUserMediaStorageConfig(album.UserID)
+	if err != nil {
+		log.Warn().Err(err).Str("userId", album.UserID).Msg("Could not load media storage config, skipping album media upload")
+		return
+	}
+
+	storage, err := NewMediaStorage(cfg.Provider)
+	if err != nil {
+		log.Warn().Err(err).Str("userId", album.UserID).Msg("Could not build media storage backend, skipping album media upload")
+		return
+	}
+
+	for i := range album.Messages {
+		msg := &album.Messages[i]
+
+		data, err := decodeMediaPayload(msg)
+		if err != nil {
+			log.Warn().Err(err).Str("albumId", album.GroupKey).Str("messageId", msg.ID).Msg("Skipping media upload, could not read payload")
+			continue
+		}
+
+		key := objectKey(cfg, album.GroupKey, msg.ID, msg.FileName)
+		result, err := storage.Upload(context.Background(), cfg, key, data, msg.MimeType)
+		if err != nil {
+			log.Warn().Err(err).Str("albumId", album.GroupKey).Str("messageId", msg.ID).Msg("Media upload failed")
+			continue
+		}
+
+		msg.S3 = map[string]interface{}{
+			"url":      result.URL,
+			"bucket":   result.Bucket,
+			"key":      result.Key,
+			"size":     result.Size,
+			"mimetype": result.MimeType,
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// userResourcePrefix is the path prefix for the /users/{id}/... admin
+// endpoints in this file and any others shaped the same way (e.g.
+// webhook_config_handler.go).
+const userResourcePrefix = "/users/"
+
+// mediaStorageConfigDTO is the wire shape for GET/PUT
+// /users/{id}/media-storage.
+type mediaStorageConfigDTO struct {
+	Provider            string `json:"provider"`
+	Endpoint            string `json:"endpoint"`
+	Bucket              string `json:"bucket"`
+	AccessKey           string `json:"accessKey"`
+	SecretKey           string `json:"secretKey"`
+	Prefix              string `json:"prefix"`
+	PresignedTTLSeconds int    `json:"presignedTtlSeconds"`
+	RetentionSeconds    int    `json:"retentionSeconds"`
+}
+
+// handleUserMediaStorage serves the admin API for the per-user
+// object-storage settings uploadAlbumMedia reads via
+// getUserMediaStorageConfig:
+//
+//	GET /users/{id}/media-storage - fetch the user's effective settings
+//	PUT /users/{id}/media-storage - replace them
+func handleUserMediaStorage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := extractUserIDFromPath(r.URL.Path, userResourcePrefix, "/media-storage")
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := getUserMediaStorageConfig(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// SecretKey is write-only: PUT accepts it, but GET never echoes it
+		// back, since this admin API isn't scoped/authenticated in this
+		// tree and there's no reason to expose the object store credential
+		// on every read.
+		dto := mediaStorageConfigToDTO(cfg)
+		dto.SecretKey = ""
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dto); err != nil {
+			log.Error().Err(err).Msg("Failed to encode media storage config response")
+		}
+
+	case http.MethodPut:
+		var dto mediaStorageConfigDTO
+		if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := SetMediaStorageConfig(userID, mediaStorageConfigFromDTO(dto)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func mediaStorageConfigToDTO(cfg MediaStorageConfig) mediaStorageConfigDTO {
+	return mediaStorageConfigDTO{
+		Provider:            cfg.Provider,
+		Endpoint:            cfg.Endpoint,
+		Bucket:              cfg.Bucket,
+		AccessKey:           cfg.AccessKey,
+		SecretKey:           cfg.SecretKey,
+		Prefix:              cfg.Prefix,
+		PresignedTTLSeconds: int(cfg.PresignedTTL.Seconds()),
+		RetentionSeconds:    int(cfg.Retention.Seconds()),
+	}
+}
+
+func mediaStorageConfigFromDTO(dto mediaStorageConfigDTO) MediaStorageConfig {
+	return MediaStorageConfig{
+		Provider:     dto.Provider,
+		Endpoint:     dto.Endpoint,
+		Bucket:       dto.Bucket,
+		AccessKey:    dto.AccessKey,
+		SecretKey:    dto.SecretKey,
+		Prefix:       dto.Prefix,
+		PresignedTTL: time.Duration(dto.PresignedTTLSeconds) * time.Second,
+		Retention:    time.Duration(dto.RetentionSeconds) * time.Second,
+	}
+}
+
+// extractUserIDFromPath pulls {id} out of a "/prefix{id}suffix" path,
+// rejecting anything empty or containing a further path segment.
+func extractUserIDFromPath(path, prefix, suffix string) (string, bool) {
+	if !strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) {
+		return "", false
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(path, prefix), suffix)
+	if id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,39 @@
+package main
+
+// messageRoutingOrder is the precedence RouteIncomingMessage checks
+// registered extractors in when more than one could plausibly match the
+// same message context (e.g. a forwarded message is also just a text
+// message): first match wins.
+var messageRoutingOrder = []EventType{
+	EventTypeAlbum,
+	EventTypeReactionBatch,
+	EventTypeForwardBundle,
+	EventTypeTextBurst,
+}
+
+// RouteIncomingMessage is the single entry point message-handling code
+// calls for every incoming event that might belong to a batch. It tries
+// each registered extractor in messageRoutingOrder, skipping any EventType
+// that's disabled, and hands the message to AddMessage for the first one
+// whose extractor matches msgContext. AlbumBuffer.AddMessage (album_buffer.go)
+// remains a thin album-only convenience wrapper for callers that already
+// know they have an album message; RouteIncomingMessage is what lets
+// TextBurst/ForwardBundle/ReactionBatch ever actually fire, since nothing
+// else in this package extracts a group key for them.
+//
+// ok is false if no enabled extractor matched, meaning the caller should
+// handle msg as a standalone event instead of a batch member.
+func (eb *EventBuffer) RouteIncomingMessage(msgContext map[string]interface{}, msg AlbumMessage, metadata *Batch) (t EventType, isFirst bool, ok bool) {
+	for _, candidate := range messageRoutingOrder {
+		extractor, registered := eb.ExtractorFor(candidate)
+		if !registered || !eb.UserBatchConfigFor(metadata.UserID, candidate).Enabled {
+			continue
+		}
+		groupKey, matched := extractor(msgContext)
+		if !matched {
+			continue
+		}
+		return candidate, eb.AddMessage(candidate, groupKey, msg, metadata), true
+	}
+	return "", false, false
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// objectStoreClient is the minimal S3-compatible wire client shared by
+// s3MediaStorage and minioMediaStorage: both speak the same SigV4-signed
+// PutObject protocol and build object URLs the same way, just against
+// different endpoints/credentials/regions.
+type objectStoreClient struct {
+	httpClient *http.Client
+	endpoint   string // host[:port], no scheme
+	region     string
+	accessKey  string
+	secretKey  string
+}
+
+// newS3Client builds the client used by s3MediaStorage, defaulting to AWS's
+// global S3 endpoint when the user hasn't configured one (e.g. for a
+// non-R2/non-custom bucket).
+func newS3Client(ctx context.Context, cfg MediaStorageConfig) (*objectStoreClient, error) {
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("s3: accessKey and secretKey are required")
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3: bucket is required")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	return &objectStoreClient{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		endpoint:   endpoint,
+		region:     "us-east-1",
+		accessKey:  cfg.AccessKey,
+		secretKey:  cfg.SecretKey,
+	}, nil
+}
+
+// newMinioClient builds the client used by minioMediaStorage. Unlike AWS S3,
+// a MinIO deployment has no sensible default endpoint, so it's required.
+func newMinioClient(ctx context.Context, cfg MediaStorageConfig) (*objectStoreClient, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("minio: endpoint is required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("minio: accessKey and secretKey are required")
+	}
+	return &objectStoreClient{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		endpoint:   cfg.Endpoint,
+		region:     "us-east-1",
+		accessKey:  cfg.AccessKey,
+		secretKey:  cfg.SecretKey,
+	}, nil
+}
+
+func (c *objectStoreClient) objectURL(bucket, key string) string {
+	return fmt.Sprintf("https://%s/%s/%s", c.endpoint, bucket, (&url.URL{Path: key}).EscapedPath())
+}
+
+// PutObject uploads data as a single request, signed with SigV4's
+// UNSIGNED-PAYLOAD variant (the request is still authenticated, just not
+// body-checksummed, which keeps this client to a manageable size).
+func (c *objectStoreClient) PutObject(ctx context.Context, bucket, key string, data []byte, mimeType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(bucket, key), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", mimeType)
+	c.sign(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignedURL returns the object's plain https URL. sign() puts its SigV4
+// signature in the request's headers, which are not part of the returned
+// string, so the URL carries no signature or expiry query parameters and
+// ttl is not applied to it.
+func (c *objectStoreClient) SignedURL(ctx context.Context, bucket, key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(bucket, key), nil)
+	if err != nil {
+		return "", fmt.Errorf("build request: %w", err)
+	}
+	c.sign(req)
+	return req.URL.String(), nil
+}
+
+// sign attaches a SigV4 Authorization header for req. This covers exactly
+// the PutObject/GetObject shape MediaStorage needs (single request, no
+// chunked transfer), not the full SigV4 spec.
+func (c *objectStoreClient) sign(req *http.Request) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	req.Host = req.URL.Host
+
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:UNSIGNED-PAYLOAD\nx-amz-date:%s\n", req.URL.Host, amzDate)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", dateStamp, c.region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(c.signingKey(dateStamp), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func (c *objectStoreClient) signingKey(dateStamp string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+c.secretKey), dateStamp)
+	kRegion := hmacSHA256(kDate, c.region)
+	kService := hmacSHA256(kRegion, "s3")
+	return hmacSHA256(kService, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// webDAVClient is the client used by webdavMediaStorage. WebDAV has no
+// bucket/presign concept, so PublicURL just returns the plain resource URL.
+type webDAVClient struct {
+	httpClient *http.Client
+	endpoint   string
+	username   string
+	password   string
+}
+
+// newWebDAVClient builds a client for a WebDAV share at endpoint,
+// authenticating with HTTP Basic auth when credentials are set.
+func newWebDAVClient(endpoint, username, password string) *webDAVClient {
+	return &webDAVClient{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		endpoint:   strings.TrimRight(endpoint, "/"),
+		username:   username,
+		password:   password,
+	}
+}
+
+// Put uploads data to path (relative to the share root) via HTTP PUT.
+func (c *webDAVClient) Put(ctx context.Context, path string, data []byte, mimeType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.endpoint+"/"+strings.TrimLeft(path, "/"), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", mimeType)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// PublicURL returns the resource's plain (unsigned) URL.
+func (c *webDAVClient) PublicURL(path string) string {
+	return c.endpoint + "/" + strings.TrimLeft(path, "/")
+}
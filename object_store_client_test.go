@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func TestHmacSHA256(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write([]byte("data"))
+	want := mac.Sum(nil)
+
+	got := hmacSHA256([]byte("key"), "data")
+	if hex.EncodeToString(got) != hex.EncodeToString(want) {
+		t.Fatalf("hmacSHA256() = %x, want %x", got, want)
+	}
+}
+
+func TestSha256Sum(t *testing.T) {
+	want := sha256.Sum256([]byte("payload"))
+	if got := sha256Sum([]byte("payload")); hex.EncodeToString(got) != hex.EncodeToString(want[:]) {
+		t.Fatalf("sha256Sum() = %x, want %x", got, want)
+	}
+}
+
+// TestSigningKeyDerivationChain pins the SigV4 key-derivation chain
+// (AWS4<secret> -> date -> region -> service -> aws4_request) to an
+// independently computed value, so a future edit that reorders or drops a
+// step in signingKey is caught even though the inputs are fixed and the
+// result doesn't depend on the current time.
+func TestSigningKeyDerivationChain(t *testing.T) {
+	c := &objectStoreClient{secretKey: "test-secret", region: "us-west-2"}
+
+	kDate := hmacSHA256([]byte("AWS4test-secret"), "20240115")
+	kRegion := hmacSHA256(kDate, "us-west-2")
+	kService := hmacSHA256(kRegion, "s3")
+	want := hmacSHA256(kService, "aws4_request")
+
+	got := c.signingKey("20240115")
+	if hex.EncodeToString(got) != hex.EncodeToString(want) {
+		t.Fatalf("signingKey() = %x, want %x", got, want)
+	}
+}
+
+// TestSignProducesVerifiableSignature exercises sign() end to end. Since
+// sign() stamps the request with time.Now() rather than an injectable
+// clock, this can't assert a literal golden signature string; instead it
+// re-derives the expected signature from the X-Amz-Date header sign()
+// actually wrote (the same approach webhook_delivery_test.go's
+// TestSignPayload uses), which still catches a broken canonical-request,
+// scope, or credential format - just not a frozen-timestamp regression.
+func TestSignProducesVerifiableSignature(t *testing.T) {
+	c := &objectStoreClient{
+		endpoint:  "s3.example.com",
+		region:    "us-east-1",
+		accessKey: "AKIDEXAMPLE",
+		secretKey: "test-secret",
+	}
+
+	req, err := http.NewRequest(http.MethodPut, "https://s3.example.com/bucket/key", nil)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.URL.Host = "s3.example.com"
+	c.sign(req)
+
+	amzDate := req.Header.Get("X-Amz-Date")
+	if amzDate == "" {
+		t.Fatal("sign() did not set X-Amz-Date")
+	}
+	dateStamp := amzDate[:8]
+
+	canonicalHeaders := "host:s3.example.com\nx-amz-content-sha256:UNSIGNED-PAYLOAD\nx-amz-date:" + amzDate + "\n"
+	canonicalRequest := req.Method + "\n" + req.URL.EscapedPath() + "\n" + req.URL.RawQuery + "\n" +
+		canonicalHeaders + "\n" + "host;x-amz-content-sha256;x-amz-date" + "\n" + "UNSIGNED-PAYLOAD"
+
+	scope := dateStamp + "/" + c.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sha256Sum([]byte(canonicalRequest)))
+	wantSignature := hex.EncodeToString(hmacSHA256(c.signingKey(dateStamp), stringToSign))
+
+	wantAuth := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/" + scope + ", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" + wantSignature
+	if got := req.Header.Get("Authorization"); got != wantAuth {
+		t.Fatalf("Authorization header = %q, want %q", got, wantAuth)
+	}
+}
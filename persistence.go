@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// batchesBucket is the BoltDB bucket pending batches are persisted under so
+// an in-flight album/burst/bundle survives a restart during its wait
+// window.
+var batchesBucket = []byte("pending_batches")
+
+// batchRecord is the on-disk form of a Batch: everything except the Timer
+// (can't be serialized) and MyCli (re-resolved from UserID/Token on
+// rehydrate).
+type batchRecord struct {
+	Type             EventType      `json:"type"`
+	GroupKey         string         `json:"groupKey"`
+	ChatJID          string         `json:"chatJid"`
+	SenderJID        string         `json:"senderJid"`
+	SenderAlt        string         `json:"senderAlt"`
+	Caption          string         `json:"caption"`
+	Timestamp        time.Time      `json:"timestamp"`
+	Messages         []AlbumMessage `json:"messages"`
+	UserID           string         `json:"userId"`
+	Token            string         `json:"token"`
+	DeliveryAttempts int            `json:"deliveryAttempts"`
+	IsGroup          bool           `json:"isGroup"`
+}
+
+// OpenPersistentStore opens (creating if necessary) the BoltDB file used to
+// persist pending batches, and attaches it to the event buffer.
+func OpenPersistentStore(eb *EventBuffer, path string) error {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return fmt.Errorf("open bolt store at %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(batchesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("create bucket: %w", err)
+	}
+
+	eb.Lock()
+	eb.store = db
+	eb.Unlock()
+
+	log.Info().Str("path", path).Msg("Event buffer persistence store opened")
+	return nil
+}
+
+// persistBatch writes (or overwrites) the current snapshot of a batch to
+// the store. Called after every AddMessage so a restart never loses more
+// than the last unsynced append.
+func (eb *EventBuffer) persistBatch(batch *Batch) {
+	if eb.store == nil {
+		return
+	}
+
+	rec := batchRecord{
+		Type:      batch.Type,
+		GroupKey:  batch.GroupKey,
+		ChatJID:   batch.ChatJID,
+		SenderJID: batch.SenderJID,
+		SenderAlt: batch.SenderAlt,
+		Caption:   batch.Caption,
+		Timestamp: batch.Timestamp,
+		Messages:  batch.Messages,
+		UserID:    batch.UserID,
+		Token:     batch.Token,
+		IsGroup:   batch.IsGroup,
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Warn().Err(err).Str("groupKey", batch.GroupKey).Msg("Failed to marshal batch for persistence")
+		return
+	}
+
+	key := []byte(batchKey(batch.Type, batch.GroupKey))
+	if err := eb.store.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(batchesBucket).Put(key, data)
+	}); err != nil {
+		log.Warn().Err(err).Str("groupKey", batch.GroupKey).Msg("Failed to persist batch")
+	}
+}
+
+// deletePersisted removes a batch's persisted record. Called once its
+// webhook has been delivered or dead-lettered (or the batch cancelled), so a
+// restart never replays a batch that has already fired.
+func (eb *EventBuffer) deletePersisted(t EventType, groupKey string) {
+	if eb.store == nil {
+		return
+	}
+	key := []byte(batchKey(t, groupKey))
+	if err := eb.store.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(batchesBucket).Delete(key)
+	}); err != nil {
+		log.Warn().Err(err).Str("groupKey", groupKey).Msg("Failed to delete persisted batch")
+	}
+}
+
+// minRehydrateRemaining clamps a rehydrated batch's remaining wait time so
+// one that was already overdue at restart flushes almost immediately
+// instead of never firing.
+const minRehydrateRemaining = 1 * time.Second
+
+// rehydrateRetryInterval is how long the pendingRehydrations backstop timer
+// waits between attempts to re-attach a batch whose client hasn't
+// reconnected yet.
+const rehydrateRetryInterval = 5 * time.Second
+
+// pendingRehydrations holds batch records Rehydrate couldn't attach a live
+// client to yet - the normal case right after a restart, since clients
+// only reconnect (and call RegisterClient) some time after the server
+// comes back up. Keyed by batchKey(type, groupKey). RegisterClient retries
+// a user's pending records the moment it's called for them; the timer
+// started by Rehydrate/retryPendingRehydrations is just a backstop for
+// records whose client never calls RegisterClient again.
+var pendingRehydrations = struct {
+	sync.Mutex
+	records map[string]batchRecord
+}{records: make(map[string]batchRecord)}
+
+// Rehydrate scans the persistence store on startup, rebuilds each pending
+// Batch, re-attaches its MyClient by looking up UserID/Token, and restarts
+// its wait timer with whatever time remains (clamped to a minimum so a
+// batch that was already overdue at restart flushes almost immediately
+// instead of being silently dropped). A record whose client hasn't
+// reconnected yet is kept (not deleted) and retried - see
+// pendingRehydrations - since the client almost never has reconnected by
+// the time Rehydrate runs right after a restart.
+func (eb *EventBuffer) Rehydrate() error {
+	if eb.store == nil {
+		return nil
+	}
+
+	var records []batchRecord
+	err := eb.store.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(batchesBucket).ForEach(func(k, v []byte) error {
+			var rec batchRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				log.Warn().Err(err).Str("key", string(k)).Msg("Skipping corrupt persisted batch record")
+				return nil
+			}
+			records = append(records, rec)
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("scan persisted batches: %w", err)
+	}
+
+	hasPending := false
+	for _, rec := range records {
+		if eb.attachRehydratedBatch(rec) {
+			continue
+		}
+		log.Warn().Str("userId", rec.UserID).Str("groupKey", rec.GroupKey).Msg("Client not connected yet for rehydrated batch, will retry once it reconnects")
+		pendingRehydrations.Lock()
+		pendingRehydrations.records[batchKey(rec.Type, rec.GroupKey)] = rec
+		pendingRehydrations.Unlock()
+		hasPending = true
+	}
+
+	if hasPending {
+		time.AfterFunc(rehydrateRetryInterval, eb.retryPendingRehydrations)
+	}
+
+	return nil
+}
+
+// attachRehydratedBatch re-attaches a persisted batch record to its live
+// client and registers it in eb.batches with a fresh wait timer. Returns
+// false (without deleting rec or logging) if no client is connected for
+// rec.UserID/Token yet, so the caller can decide how to retry.
+func (eb *EventBuffer) attachRehydratedBatch(rec batchRecord) bool {
+	cli, err := lookupClientForUser(rec.UserID, rec.Token)
+	if err != nil {
+		return false
+	}
+
+	cfg := eb.BatchConfigFor(rec.Type)
+	remaining := time.Until(rec.Timestamp.Add(time.Duration(cfg.WaitSeconds) * time.Second))
+	if remaining < minRehydrateRemaining {
+		remaining = minRehydrateRemaining
+	}
+
+	batch := &Batch{
+		Type:      rec.Type,
+		GroupKey:  rec.GroupKey,
+		ChatJID:   rec.ChatJID,
+		SenderJID: rec.SenderJID,
+		SenderAlt: rec.SenderAlt,
+		Caption:   rec.Caption,
+		Timestamp: rec.Timestamp,
+		Messages:  rec.Messages,
+		UserID:    rec.UserID,
+		Token:     rec.Token,
+		MyCli:     cli,
+		IsGroup:   rec.IsGroup,
+	}
+
+	t, groupKey := rec.Type, rec.GroupKey
+	batch.Timer = time.AfterFunc(remaining, func() {
+		eb.flushBatch(t, groupKey, "timer")
+	})
+
+	eb.Lock()
+	eb.batches[batchKey(t, groupKey)] = batch
+	eb.Unlock()
+
+	log.Info().
+		Str("eventType", string(t)).
+		Str("groupKey", groupKey).
+		Dur("remaining", remaining).
+		Int("messages", len(batch.Messages)).
+		Msg("Rehydrated pending batch from persistence store")
+
+	return true
+}
+
+// retryPendingRehydrations re-attempts every still-pending rehydration,
+// removing each one that succeeds. If any remain, it reschedules itself -
+// this is the backstop for a record whose client never calls
+// RegisterClient again (retryPendingRehydrationsForUser handles the normal
+// case of a client reconnecting).
+func (eb *EventBuffer) retryPendingRehydrations() {
+	pendingRehydrations.Lock()
+	recs := make([]batchRecord, 0, len(pendingRehydrations.records))
+	for _, rec := range pendingRehydrations.records {
+		recs = append(recs, rec)
+	}
+	pendingRehydrations.Unlock()
+
+	stillPending := false
+	for _, rec := range recs {
+		if eb.attachRehydratedBatch(rec) {
+			pendingRehydrations.Lock()
+			delete(pendingRehydrations.records, batchKey(rec.Type, rec.GroupKey))
+			pendingRehydrations.Unlock()
+		} else {
+			stillPending = true
+		}
+	}
+
+	if stillPending {
+		time.AfterFunc(rehydrateRetryInterval, eb.retryPendingRehydrations)
+	}
+}
+
+// retryPendingRehydrationsForUser immediately re-attempts any pending
+// rehydrations for userID. Called from RegisterClient so a batch persisted
+// before a restart attaches the moment its client reconnects, instead of
+// waiting for the next retryPendingRehydrations timer tick.
+func (eb *EventBuffer) retryPendingRehydrationsForUser(userID string) {
+	pendingRehydrations.Lock()
+	var recs []batchRecord
+	for _, rec := range pendingRehydrations.records {
+		if rec.UserID == userID {
+			recs = append(recs, rec)
+		}
+	}
+	pendingRehydrations.Unlock()
+
+	for _, rec := range recs {
+		if eb.attachRehydratedBatch(rec) {
+			pendingRehydrations.Lock()
+			delete(pendingRehydrations.records, batchKey(rec.Type, rec.GroupKey))
+			pendingRehydrations.Unlock()
+		}
+	}
+}
+
+// PendingBatchSummary is the shape returned by GET /albums/pending.
+type PendingBatchSummary struct {
+	Type          string `json:"type"`
+	GroupKey      string `json:"groupKey"`
+	ChatJID       string `json:"chatJid"`
+	TotalMessages int    `json:"totalMessages"`
+	AgeSeconds    int    `json:"ageSeconds"`
+}
+
+// PendingBatches returns a snapshot of every batch currently buffered
+// in-memory, for the GET /albums/pending admin endpoint.
+func (eb *EventBuffer) PendingBatches() []PendingBatchSummary {
+	eb.RLock()
+	defer eb.RUnlock()
+
+	summaries := make([]PendingBatchSummary, 0, len(eb.batches))
+	now := time.Now()
+	for _, batch := range eb.batches {
+		summaries = append(summaries, PendingBatchSummary{
+			Type:          string(batch.Type),
+			GroupKey:      batch.GroupKey,
+			ChatJID:       batch.ChatJID,
+			TotalMessages: len(batch.Messages),
+			AgeSeconds:    int(now.Sub(batch.Timestamp).Seconds()),
+		})
+	}
+	return summaries
+}
+
+// handleAlbumsPending serves GET /albums/pending, returning a snapshot of
+// every batch (album or otherwise) currently sitting in the buffer.
+func handleAlbumsPending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(eventBuffer.PendingBatches()); err != nil {
+		log.Error().Err(err).Msg("Failed to encode pending albums response")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TestRehydrateClampsOverdueRemainingTime proves an already-overdue batch
+// (its wait window elapsed while the server was down) flushes almost
+// immediately on rehydrate instead of waiting out its original duration.
+func TestRehydrateClampsOverdueRemainingTime(t *testing.T) {
+	InitEventBuffer()
+	path := filepath.Join(t.TempDir(), "batches.db")
+	if err := OpenPersistentStore(eventBuffer, path); err != nil {
+		t.Fatalf("OpenPersistentStore: %v", err)
+	}
+	eventBuffer.RegisterGroupKeyExtractor(EventTypeAlbum, HasParentMessageKey, BatchConfig{WaitSeconds: 5, Enabled: true})
+
+	RegisterClient("rehydrate-user1", "tok1", &MyClient{})
+	defer UnregisterClient("rehydrate-user1")
+
+	overdue := &Batch{
+		Type:      EventTypeAlbum,
+		GroupKey:  "album1",
+		Timestamp: time.Now().Add(-10 * time.Second),
+		UserID:    "rehydrate-user1",
+		Token:     "tok1",
+		Messages:  []AlbumMessage{{ID: "m1"}},
+	}
+	eventBuffer.persistBatch(overdue)
+
+	if err := eventBuffer.Rehydrate(); err != nil {
+		t.Fatalf("Rehydrate: %v", err)
+	}
+
+	if got := eventBuffer.GetPendingCount(); got != 1 {
+		t.Fatalf("expected the overdue batch to be attached immediately, pending count = %d", got)
+	}
+
+	time.Sleep(1300 * time.Millisecond)
+	if got := eventBuffer.GetPendingCount(); got != 0 {
+		t.Fatalf("expected the clamped timer to have flushed the batch by now, pending count = %d", got)
+	}
+}
+
+// TestRehydrateRetriesInsteadOfDeletingWhenClientNotConnected proves the
+// fix for dropping a rehydrated batch on the very first lookup attempt:
+// Rehydrate must leave the persisted record in place (not delete it) when
+// no client is connected yet, and attaching the client later (via
+// RegisterClient) must pick the batch back up without it ever having been
+// lost.
+func TestRehydrateRetriesInsteadOfDeletingWhenClientNotConnected(t *testing.T) {
+	InitEventBuffer()
+	path := filepath.Join(t.TempDir(), "batches.db")
+	if err := OpenPersistentStore(eventBuffer, path); err != nil {
+		t.Fatalf("OpenPersistentStore: %v", err)
+	}
+	eventBuffer.RegisterGroupKeyExtractor(EventTypeAlbum, HasParentMessageKey, BatchConfig{WaitSeconds: 30, Enabled: true})
+
+	pending := &Batch{
+		Type:      EventTypeAlbum,
+		GroupKey:  "album2",
+		Timestamp: time.Now(),
+		UserID:    "rehydrate-user2",
+		Token:     "tok2",
+		Messages:  []AlbumMessage{{ID: "m1"}},
+	}
+	eventBuffer.persistBatch(pending)
+
+	// No client registered for rehydrate-user2 yet: Rehydrate must not
+	// attach the batch in memory...
+	if err := eventBuffer.Rehydrate(); err != nil {
+		t.Fatalf("Rehydrate: %v", err)
+	}
+	if got := eventBuffer.GetPendingCount(); got != 0 {
+		t.Fatalf("expected no in-memory batch before the client connects, got %d", got)
+	}
+
+	// ...but it also must not have deleted the persisted record.
+	var stillPersisted bool
+	if err := eventBuffer.store.View(func(tx *bolt.Tx) error {
+		stillPersisted = tx.Bucket(batchesBucket).Get([]byte(batchKey(EventTypeAlbum, "album2"))) != nil
+		return nil
+	}); err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if !stillPersisted {
+		t.Fatal("expected the persisted record to survive a failed lookup, not be deleted")
+	}
+
+	// Once the client reconnects, RegisterClient should immediately attach
+	// the pending rehydration rather than waiting for the retry timer.
+	RegisterClient("rehydrate-user2", "tok2", &MyClient{})
+	defer UnregisterClient("rehydrate-user2")
+
+	if got := eventBuffer.GetPendingCount(); got != 1 {
+		t.Fatalf("expected RegisterClient to attach the pending batch, pending count = %d", got)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// mediaStorageConfigBucket holds each user's object-storage settings
+// (provider/endpoint/bucket/access+secret key/prefix/retention/TTL) - the
+// users-table columns this feature was asked to add, kept in their own
+// BoltDB bucket since this tree has no users table/DB layer to add columns
+// to.
+var mediaStorageConfigBucket = []byte("user_media_storage_config")
+
+// webhookConfigBucket holds each user's webhook delivery settings (URL,
+// HMAC secret, max delivery attempts) read by getUserWebhookConfig.
+var webhookConfigBucket = []byte("user_webhook_config")
+
+// userSettingsStore is the shared BoltDB handle backing per-user settings.
+// It reuses the same database file as the pending-batches store (see
+// persistence.go) instead of opening a second one.
+var userSettingsStore *bolt.DB
+
+// OpenUserSettingsStore attaches db as the backing store for per-user
+// settings and creates the buckets this file owns. Call once at startup,
+// after OpenPersistentStore has opened db.
+func OpenUserSettingsStore(db *bolt.DB) error {
+	userSettingsStore = db
+	return db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(mediaStorageConfigBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(webhookConfigBucket)
+		return err
+	})
+}
+
+// mediaStorageConfigRecord is the on-disk form of MediaStorageConfig;
+// durations are stored in seconds since time.Duration doesn't round-trip
+// through JSON on its own.
+type mediaStorageConfigRecord struct {
+	Provider            string `json:"provider"`
+	Endpoint            string `json:"endpoint"`
+	Bucket              string `json:"bucket"`
+	AccessKey           string `json:"accessKey"`
+	SecretKey           string `json:"secretKey"`
+	Prefix              string `json:"prefix"`
+	PresignedTTLSeconds int    `json:"presignedTtlSeconds"`
+	RetentionSeconds    int    `json:"retentionSeconds"`
+}
+
+// SetMediaStorageConfig stores a user's object-storage settings, used by the
+// PUT /users/{id}/media-storage admin endpoint.
+func SetMediaStorageConfig(userID string, cfg MediaStorageConfig) error {
+	if userSettingsStore == nil {
+		return fmt.Errorf("user settings store not initialized")
+	}
+
+	rec := mediaStorageConfigRecord{
+		Provider:            cfg.Provider,
+		Endpoint:            cfg.Endpoint,
+		Bucket:              cfg.Bucket,
+		AccessKey:           cfg.AccessKey,
+		SecretKey:           cfg.SecretKey,
+		Prefix:              cfg.Prefix,
+		PresignedTTLSeconds: int(cfg.PresignedTTL.Seconds()),
+		RetentionSeconds:    int(cfg.Retention.Seconds()),
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal media storage config: %w", err)
+	}
+
+	return userSettingsStore.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(mediaStorageConfigBucket).Put([]byte(userID), data)
+	})
+}
+
+// getUserMediaStorageConfig loads a user's object-storage settings. Users
+// with nothing configured default to local-disk storage so album media
+// still gets persisted somewhere rather than upload failing outright.
+func getUserMediaStorageConfig(userID string) (MediaStorageConfig, error) {
+	if userSettingsStore == nil {
+		return MediaStorageConfig{}, fmt.Errorf("user settings store not initialized")
+	}
+
+	var data []byte
+	err := userSettingsStore.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(mediaStorageConfigBucket).Get([]byte(userID)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return MediaStorageConfig{}, fmt.Errorf("load media storage config: %w", err)
+	}
+	if data == nil {
+		return MediaStorageConfig{Provider: "local-disk"}, nil
+	}
+
+	var rec mediaStorageConfigRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return MediaStorageConfig{}, fmt.Errorf("unmarshal media storage config: %w", err)
+	}
+	return MediaStorageConfig{
+		Provider:     rec.Provider,
+		Endpoint:     rec.Endpoint,
+		Bucket:       rec.Bucket,
+		AccessKey:    rec.AccessKey,
+		SecretKey:    rec.SecretKey,
+		Prefix:       rec.Prefix,
+		PresignedTTL: time.Duration(rec.PresignedTTLSeconds) * time.Second,
+		Retention:    time.Duration(rec.RetentionSeconds) * time.Second,
+	}, nil
+}
+
+// defaultWebhookMaxAttempts is used for users who haven't configured a
+// max-attempts override.
+const defaultWebhookMaxAttempts = 5
+
+// webhookConfigRecord is the on-disk form of a user's webhook settings.
+type webhookConfigRecord struct {
+	URL         string `json:"url"`
+	Secret      string `json:"secret"`
+	MaxAttempts int    `json:"maxAttempts"`
+}
+
+// SetWebhookConfig stores a user's webhook delivery settings, used by the
+// PUT /users/{id}/webhook-config admin endpoint.
+func SetWebhookConfig(userID, url, secret string, maxAttempts int) error {
+	if userSettingsStore == nil {
+		return fmt.Errorf("user settings store not initialized")
+	}
+	data, err := json.Marshal(webhookConfigRecord{URL: url, Secret: secret, MaxAttempts: maxAttempts})
+	if err != nil {
+		return fmt.Errorf("marshal webhook config: %w", err)
+	}
+	return userSettingsStore.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookConfigBucket).Put([]byte(userID), data)
+	})
+}
+
+// getUserWebhookConfig loads a user's webhook URL/HMAC secret/max delivery
+// attempts, as read by sendBatchWebhook (event_buffer.go) before enqueuing
+// a batch's webhook job. A user with no URL configured can't be delivered
+// to, so that's reported as an error rather than silently defaulted.
+func getUserWebhookConfig(userID string) (url, secret string, maxAttempts int, err error) {
+	if userSettingsStore == nil {
+		return "", "", 0, fmt.Errorf("user settings store not initialized")
+	}
+
+	var data []byte
+	err = userSettingsStore.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(webhookConfigBucket).Get([]byte(userID)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", 0, fmt.Errorf("load webhook config: %w", err)
+	}
+	if data == nil {
+		return "", "", 0, fmt.Errorf("no webhook configured for user %s", userID)
+	}
+
+	var rec webhookConfigRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return "", "", 0, fmt.Errorf("unmarshal webhook config: %w", err)
+	}
+	if rec.URL == "" {
+		return "", "", 0, fmt.Errorf("no webhook url configured for user %s", userID)
+	}
+	if rec.MaxAttempts <= 0 {
+		rec.MaxAttempts = defaultWebhookMaxAttempts
+	}
+	return rec.URL, rec.Secret, rec.MaxAttempts, nil
+}
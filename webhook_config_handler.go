@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// webhookConfigDTO is the wire shape for GET/PUT
+// /users/{id}/webhook-config.
+type webhookConfigDTO struct {
+	URL         string `json:"url"`
+	Secret      string `json:"secret"`
+	MaxAttempts int    `json:"maxAttempts"`
+}
+
+// handleUserWebhookConfig serves the admin API for the per-user webhook
+// settings getUserWebhookConfig reads before a batch's webhook job is
+// enqueued:
+//
+//	GET /users/{id}/webhook-config - fetch the user's webhook settings
+//	PUT /users/{id}/webhook-config - replace them
+func handleUserWebhookConfig(w http.ResponseWriter, r *http.Request) {
+	userID, ok := extractUserIDFromPath(r.URL.Path, userResourcePrefix, "/webhook-config")
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		url, _, maxAttempts, err := getUserWebhookConfig(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		// Secret is write-only: PUT accepts it, but GET never echoes it
+		// back, since this admin API isn't scoped/authenticated in this
+		// tree and there's no reason to expose the webhook HMAC secret on
+		// every read.
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(webhookConfigDTO{URL: url, MaxAttempts: maxAttempts}); err != nil {
+			log.Error().Err(err).Msg("Failed to encode webhook config response")
+		}
+
+	case http.MethodPut:
+		var dto webhookConfigDTO
+		if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if dto.URL == "" {
+			http.Error(w, "url is required", http.StatusBadRequest)
+			return
+		}
+		if err := SetWebhookConfig(userID, dto.URL, dto.Secret, dto.MaxAttempts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// WebhookJob is one attempt-or-retry of delivering a single webhook body to
+// a single user's endpoint.
+type WebhookJob struct {
+	IdempotencyKey string
+	UserID         string
+	URL            string
+	Secret         string
+	Payload        map[string]interface{}
+	Attempt        int
+	MaxAttempts    int
+
+	// BatchType/BatchGroupKey identify the persisted batch (see
+	// persistence.go) this job originated from, if any, so its record can
+	// be dropped once delivery is resolved (success or dead-letter) rather
+	// than at enqueue time.
+	BatchType     EventType
+	BatchGroupKey string
+}
+
+// DeadLetter is a delivery that exhausted its retries, kept around so an
+// operator can inspect and manually retry it.
+type DeadLetter struct {
+	ID             string    `json:"id"`
+	IdempotencyKey string    `json:"idempotencyKey"`
+	UserID         string    `json:"userId"`
+	URL            string    `json:"url"`
+	Payload        string    `json:"payload"`
+	LastError      string    `json:"lastError"`
+	Attempts       int       `json:"attempts"`
+	FailedAt       time.Time `json:"failedAt"`
+}
+
+// DeadLetterStore holds permanently-failed deliveries in memory for the
+// GET /webhook/failures / POST /webhook/failures/{id}/retry admin API.
+type DeadLetterStore struct {
+	sync.RWMutex
+	next  int
+	items map[string]DeadLetter
+}
+
+// NewDeadLetterStore returns an empty DeadLetterStore.
+func NewDeadLetterStore() *DeadLetterStore {
+	return &DeadLetterStore{items: make(map[string]DeadLetter)}
+}
+
+func (s *DeadLetterStore) add(job WebhookJob, lastErr error) string {
+	s.Lock()
+	defer s.Unlock()
+
+	s.next++
+	id := fmt.Sprintf("dlq-%d", s.next)
+	body, _ := json.Marshal(job.Payload)
+
+	s.items[id] = DeadLetter{
+		ID:             id,
+		IdempotencyKey: job.IdempotencyKey,
+		UserID:         job.UserID,
+		URL:            job.URL,
+		Payload:        string(body),
+		LastError:      lastErr.Error(),
+		Attempts:       job.Attempt + 1,
+		FailedAt:       time.Now(),
+	}
+	return id
+}
+
+// List returns every dead-lettered delivery.
+func (s *DeadLetterStore) List() []DeadLetter {
+	s.RLock()
+	defer s.RUnlock()
+	out := make([]DeadLetter, 0, len(s.items))
+	for _, d := range s.items {
+		out = append(out, d)
+	}
+	return out
+}
+
+// Remove drops a dead letter, e.g. once it has been requeued.
+func (s *DeadLetterStore) Remove(id string) (DeadLetter, bool) {
+	s.Lock()
+	defer s.Unlock()
+	d, ok := s.items[id]
+	if ok {
+		delete(s.items, id)
+	}
+	return d, ok
+}
+
+// WebhookDispatcher delivers webhook jobs through a bounded worker pool so
+// one slow/unreachable endpoint can't stall delivery for every other user.
+// Failed jobs are retried with exponential backoff and jitter up to
+// job.MaxAttempts, then handed to the DeadLetterStore.
+type WebhookDispatcher struct {
+	jobs        chan WebhookJob
+	workers     int
+	client      *http.Client
+	deadLetters *DeadLetterStore
+}
+
+// Global webhook dispatcher instance, started by InitWebhookDispatcher.
+var webhookDispatcher *WebhookDispatcher
+
+// InitWebhookDispatcher creates and starts the global dispatcher with the
+// given worker pool size.
+func InitWebhookDispatcher(workers int) {
+	webhookDispatcher = &WebhookDispatcher{
+		jobs:        make(chan WebhookJob, workers*10),
+		workers:     workers,
+		client:      &http.Client{Timeout: 15 * time.Second},
+		deadLetters: NewDeadLetterStore(),
+	}
+	for i := 0; i < workers; i++ {
+		go webhookDispatcher.worker()
+	}
+	log.Info().Int("workers", workers).Msg("Webhook dispatcher started")
+}
+
+// Enqueue queues a job for delivery. Safe to call from any goroutine.
+func (d *WebhookDispatcher) Enqueue(job WebhookJob) {
+	d.jobs <- job
+}
+
+func (d *WebhookDispatcher) worker() {
+	for job := range d.jobs {
+		d.attempt(job)
+	}
+}
+
+func (d *WebhookDispatcher) attempt(job WebhookJob) {
+	body, err := json.Marshal(job.Payload)
+	if err != nil {
+		log.Error().Err(err).Str("idempotencyKey", job.IdempotencyKey).Msg("Failed to marshal webhook payload")
+		return
+	}
+
+	start := time.Now()
+	deliverErr := d.post(job.URL, job.Secret, job.IdempotencyKey, body)
+	elapsed := time.Since(start).Seconds()
+
+	if deliverErr == nil {
+		webhookDeliveryDuration.WithLabelValues("success").Observe(elapsed)
+		webhookDeliveryTotal.WithLabelValues("success").Inc()
+		log.Info().
+			Str("idempotencyKey", job.IdempotencyKey).
+			Str("userId", job.UserID).
+			Int("attempt", job.Attempt+1).
+			Msg("Webhook delivered")
+		d.forgetPersistedBatch(job)
+		return
+	}
+
+	webhookDeliveryDuration.WithLabelValues("error").Observe(elapsed)
+
+	log.Warn().
+		Err(deliverErr).
+		Str("idempotencyKey", job.IdempotencyKey).
+		Str("userId", job.UserID).
+		Int("attempt", job.Attempt+1).
+		Int("maxAttempts", job.MaxAttempts).
+		Msg("Webhook delivery attempt failed")
+
+	if job.Attempt+1 >= job.MaxAttempts {
+		webhookDeliveryTotal.WithLabelValues("dead_letter").Inc()
+		id := d.deadLetters.add(job, deliverErr)
+		log.Error().
+			Str("idempotencyKey", job.IdempotencyKey).
+			Str("deadLetterId", id).
+			Msg("Webhook delivery exhausted retries, moved to dead-letter queue")
+		d.forgetPersistedBatch(job)
+		return
+	}
+
+	webhookDeliveryTotal.WithLabelValues("retry").Inc()
+
+	next := job
+	next.Attempt++
+	time.AfterFunc(retryBackoff(next.Attempt), func() {
+		d.Enqueue(next)
+	})
+}
+
+// forgetPersistedBatch drops the batch's persistence record once its
+// delivery has been resolved, successfully or not (a permanently failed
+// delivery lives on in the dead-letter queue, not the pending-batches
+// store).
+func (d *WebhookDispatcher) forgetPersistedBatch(job WebhookJob) {
+	if job.BatchGroupKey == "" || eventBuffer == nil {
+		return
+	}
+	eventBuffer.deletePersisted(job.BatchType, job.BatchGroupKey)
+}
+
+func (d *WebhookDispatcher) post(url, secret, idempotencyKey string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Wuzapi-Signature", signPayload(secret, body))
+	req.Header.Set("X-Wuzapi-Idempotency-Key", idempotencyKey)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signPayload computes the HMAC-SHA256 signature sent in the
+// X-Wuzapi-Signature header, hex-encoded, over the raw JSON body.
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryBackoff returns an exponential backoff duration (capped at 1 minute)
+// with up to 50% jitter, for the given attempt number (1-indexed).
+func retryBackoff(attempt int) time.Duration {
+	base := time.Duration(1<<uint(attempt)) * time.Second
+	maxBackoff := 60 * time.Second
+	if base > maxBackoff {
+		base = maxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(base)/2 + 1))
+	return base + jitter
+}
+
+// handleWebhookFailures serves GET /webhook/failures (list) and
+// POST /webhook/failures/{id}/retry (requeue a dead-lettered delivery).
+func handleWebhookFailures(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/webhook/failures/"
+
+	if r.Method == http.MethodGet && r.URL.Path == "/webhook/failures" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(webhookDispatcher.deadLetters.List()); err != nil {
+			log.Error().Err(err).Msg("Failed to encode webhook failures response")
+		}
+		return
+	}
+
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, prefix) && strings.HasSuffix(r.URL.Path, "/retry") {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/retry")
+		dl, ok := webhookDispatcher.deadLetters.Remove(id)
+		if !ok {
+			http.Error(w, "dead letter not found", http.StatusNotFound)
+			return
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(dl.Payload), &payload); err != nil {
+			http.Error(w, "corrupt dead letter payload", http.StatusInternalServerError)
+			return
+		}
+
+		webhookDispatcher.Enqueue(WebhookJob{
+			IdempotencyKey: dl.IdempotencyKey,
+			UserID:         dl.UserID,
+			URL:            dl.URL,
+			Payload:        payload,
+			Attempt:        0,
+			MaxAttempts:    1, // manual retry: single attempt, back to the dead-letter queue on failure
+		})
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	http.Error(w, "not found", http.StatusNotFound)
+}
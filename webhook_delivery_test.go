@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestSignPayload(t *testing.T) {
+	body := []byte(`{"hello":"world"}`)
+
+	got := signPayload("my-secret", body)
+
+	mac := hmac.New(sha256.New, []byte("my-secret"))
+	mac.Write(body)
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	if got != want {
+		t.Fatalf("signPayload() = %q, want %q", got, want)
+	}
+}
+
+func TestSignPayloadDifferentSecretsDiffer(t *testing.T) {
+	body := []byte(`{"hello":"world"}`)
+	if signPayload("secret-a", body) == signPayload("secret-b", body) {
+		t.Fatal("expected different secrets to produce different signatures")
+	}
+}
+
+func TestRetryBackoffGrowsAndCaps(t *testing.T) {
+	const maxBackoff = 60 * time.Second
+
+	prevBase := time.Duration(0)
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := retryBackoff(attempt)
+
+		base := time.Duration(1<<uint(attempt)) * time.Second
+		if base > maxBackoff {
+			base = maxBackoff
+		}
+		maxWithJitter := base + base/2 + time.Second // jitter is up to ~50% of base, plus rounding slack
+
+		if d < base {
+			t.Fatalf("attempt %d: retryBackoff() = %v, want >= base %v", attempt, d, base)
+		}
+		if d > maxWithJitter {
+			t.Fatalf("attempt %d: retryBackoff() = %v, want <= %v", attempt, d, maxWithJitter)
+		}
+		if base < prevBase {
+			t.Fatalf("attempt %d: base backoff decreased from a prior attempt", attempt)
+		}
+		prevBase = base
+	}
+}
+
+func TestRetryBackoffNeverExceedsCapPlusJitter(t *testing.T) {
+	d := retryBackoff(30) // 2^30s (about 34 years) without the cap
+	if d > 90*time.Second {
+		t.Fatalf("retryBackoff(30) = %v, want <= 90s (60s cap + 50%% jitter)", d)
+	}
+}